@@ -7,20 +7,26 @@ package sse
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	backoff "gopkg.in/cenkalti/backoff.v1"
 )
 
 var (
-	headerID    = []byte("id:")
-	headerData  = []byte("data:")
-	headerEvent = []byte("event:")
-	headerError = []byte("error:")
+	headerID      = []byte("id:")
+	headerData    = []byte("data:")
+	headerEvent   = []byte("event:")
+	headerError   = []byte("error:")
+	headerRetry   = []byte("retry:")
+	headerComment = []byte(":")
 )
 
 // Client handles an incoming server stream
@@ -30,7 +36,10 @@ type Client struct {
 	Headers        map[string]string
 	EncodingBase64 bool
 	EventID        string
-	subscribed     map[chan *Event]chan bool
+	// ReconnectTime seeds the initial reconnect delay. It is overridden by
+	// any "retry:" field the server sends once the stream is connected.
+	ReconnectTime time.Duration
+	subscribed    map[chan *Event]chan bool
 
 	sync.Mutex
 }
@@ -47,76 +56,136 @@ func NewClient(url string) *Client {
 
 // Subscribe to a data stream
 func (c *Client) Subscribe(stream string, handler func(msg *Event)) error {
+	return c.SubscribeWithContext(context.Background(), stream, handler)
+}
+
+// SubscribeWithContext is like Subscribe, but the subscription and its
+// in-flight request are cancelled as soon as ctx is done, not only when the
+// reconnection backoff gives up.
+func (c *Client) SubscribeWithContext(ctx context.Context, stream string, handler func(msg *Event)) error {
+	eb := c.newBackOff()
+
 	operation := func() error {
-		resp, err := c.request(stream)
+		resp, err := c.request(ctx, stream)
 		if err != nil {
 			return err
 		}
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Split(scanLines)
 
-		for {
-			// Read each new line and process the type of event
-			line, err := reader.ReadBytes('\n')
-			if err != nil {
-				return err
+		var p pending
+		for scanner.Scan() {
+			line := scanner.Bytes()
+
+			if d, ok := parseRetry(line); ok {
+				c.applyRetry(eb, d)
+				continue
 			}
-			msg := c.processEvent(line)
-			if msg != nil {
-				handler(msg)
+
+			if c.processLine(&p, line) {
+				c.trackEventID(&p.Event)
+				if p.gotData {
+					e, err := c.finalize(p)
+					if err != nil {
+						log.Println(err)
+					}
+					handler(e)
+				}
+				p = pending{}
 			}
 		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return io.EOF
 	}
-	return backoff.Retry(operation, backoff.NewExponentialBackOff())
+
+	return backoff.Retry(operation, backoff.WithContext(eb, ctx))
 }
 
-// SubscribeChan sends all events to the provided channel
+// SubscribeChan sends all events to the provided channel. It returns
+// immediately; connecting, reading and reconnecting all happen in the
+// background, with any error logged, until ch is unsubscribed.
 func (c *Client) SubscribeChan(stream string, ch chan *Event) error {
-	c.subscribed[ch] = make(chan bool)
+	go func() {
+		if err := c.SubscribeChanWithContext(context.Background(), stream, ch, nil); err != nil {
+			log.Println(err)
+		}
+	}()
+	return nil
+}
+
+// SubscribeChanWithContext is like SubscribeChan, but it blocks for the
+// life of the subscription instead of running in the background, the
+// in-flight request is cancelled as soon as ctx is done, and transport
+// errors, non-200 responses and malformed frames are reported on errCh
+// instead of being logged. errCh may be nil, in which case they are logged
+// as before.
+func (c *Client) SubscribeChanWithContext(ctx context.Context, stream string, ch chan *Event, errCh chan error) error {
+	c.subscribed[ch] = make(chan bool, 1)
+	defer c.teardown(ch)
+
+	eb := c.newBackOff()
 
 	operation := func() error {
-		resp, err := c.request(stream)
+		resp, err := c.request(ctx, stream)
 		if err != nil {
-			c.cleanup(resp, ch)
+			c.reportError(errCh, err)
 			return err
 		}
+		defer resp.Body.Close()
 
 		if resp.StatusCode != 200 {
-			c.cleanup(resp, ch)
-			return errors.New("could not connect to stream")
+			err := errors.New("could not connect to stream")
+			c.reportError(errCh, err)
+			return err
 		}
 
-		reader := bufio.NewReader(resp.Body)
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Split(scanLines)
 
-		go func() {
-			for {
-				// Read each new line and process the type of event
-				line, err := reader.ReadBytes('\n')
-				if err != nil {
-					c.cleanup(resp, ch)
-					return
-				}
+		var p pending
+		for scanner.Scan() {
+			line := scanner.Bytes()
 
-				msg := c.processEvent(line)
-				if msg == nil {
-					continue
-				}
+			if d, ok := parseRetry(line); ok {
+				c.applyRetry(eb, d)
+				continue
+			}
 
-				select {
-				case <-c.subscribed[ch]:
-					c.cleanup(resp, ch)
-					return
-				case ch <- msg:
-					// message sent
-				}
+			if !c.processLine(&p, line) {
+				continue
 			}
-		}()
 
-		return nil
+			c.trackEventID(&p.Event)
+			if !p.gotData {
+				p = pending{}
+				continue
+			}
+
+			msg, err := c.finalize(p)
+			if err != nil {
+				c.reportError(errCh, err)
+			}
+			p = pending{}
+
+			select {
+			case <-c.subscribed[ch]:
+				return nil
+			case ch <- msg:
+				// message sent
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			c.reportError(errCh, err)
+			return err
+		}
+		return io.EOF
 	}
 
-	return backoff.Retry(operation, backoff.NewExponentialBackOff())
+	return backoff.Retry(operation, backoff.WithContext(eb, ctx))
 }
 
 // SubscribeRaw to an sse endpoint
@@ -134,16 +203,24 @@ func (c *Client) Unsubscribe(ch chan *Event) {
 	c.Lock()
 	defer c.Unlock()
 
-	if c.subscribed[ch] != nil {
-		c.subscribed[ch] <- true
+	stop := c.subscribed[ch]
+	if stop == nil {
+		return
+	}
+
+	select {
+	case stop <- true:
+	default:
+		// Already signalled.
 	}
 }
 
-func (c *Client) request(stream string) (*http.Response, error) {
+func (c *Client) request(ctx context.Context, stream string) (*http.Response, error) {
 	req, err := http.NewRequest("GET", c.URL, nil)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	// Setup request, specify stream to connect to
 	if stream != "" {
@@ -156,8 +233,12 @@ func (c *Client) request(stream string) (*http.Response, error) {
 	req.Header.Set("Accept", "text/event-stream")
 	req.Header.Set("Connection", "keep-alive")
 
-	if c.EventID != "" {
-		req.Header.Set("Last-Event-ID", c.EventID)
+	c.Lock()
+	eventID := c.EventID
+	c.Unlock()
+
+	if eventID != "" {
+		req.Header.Set("Last-Event-ID", eventID)
 	}
 
 	// Add user specified headers
@@ -168,41 +249,173 @@ func (c *Client) request(stream string) (*http.Response, error) {
 	return c.Connection.Do(req)
 }
 
-func (c *Client) processEvent(msg []byte) *Event {
-	var e Event
+// pending accumulates the fields of an in-progress event across the lines
+// read between two blank lines.
+type pending struct {
+	Event
+	gotData bool
+}
 
-	switch h := msg; {
-	case bytes.Contains(h, headerID):
-		e.ID = trimHeader(len(headerID), msg)
-	case bytes.Contains(h, headerData):
-		e.Data = trimHeader(len(headerData), msg)
-	case bytes.Contains(h, headerEvent):
-		e.Event = trimHeader(len(headerEvent), msg)
-	case bytes.Contains(h, headerError):
-		e.Error = trimHeader(len(headerError), msg)
-	default:
-		return nil
+// newBackOff builds the reconnection policy for a subscription, seeded from
+// Client.ReconnectTime when set.
+func (c *Client) newBackOff() *backoff.ExponentialBackOff {
+	b := backoff.NewExponentialBackOff()
+	if c.ReconnectTime > 0 {
+		b.InitialInterval = c.ReconnectTime
+	}
+	return b
+}
+
+// applyRetry updates b's interval from a server-provided "retry:" field and
+// resets it so the new value is used on the next reconnect.
+func (c *Client) applyRetry(b *backoff.ExponentialBackOff, d time.Duration) {
+	b.InitialInterval = d
+	b.MaxInterval = d
+	b.Reset()
+}
+
+// parseRetry extracts the millisecond value of a "retry:" field. Malformed
+// or absent fields are reported via ok, matching the spec's instruction to
+// ignore invalid retry values.
+func parseRetry(line []byte) (d time.Duration, ok bool) {
+	if !bytes.HasPrefix(line, headerRetry) {
+		return 0, false
+	}
+
+	millis, err := strconv.Atoi(string(trimField(headerRetry, line)))
+	if err != nil {
+		return 0, false
+	}
+
+	return time.Duration(millis) * time.Millisecond, true
+}
+
+// trackEventID records the last seen event ID so the next reconnect sends
+// it as Last-Event-ID, per the SSE stream-resumption semantics.
+func (c *Client) trackEventID(e *Event) {
+	if len(e.ID) == 0 {
+		return
+	}
+
+	c.Lock()
+	c.EventID = string(e.ID)
+	c.Unlock()
+}
+
+// processLine folds a single unterminated line of the stream into p. It
+// returns true once a blank line is seen, ending the event p accumulated.
+// Per the SSE spec, callers should still track p's ID even then, but only
+// dispatch it when p.gotData is set — a frame with only a comment, an id,
+// or nothing at all (e.g. a ": ping" keepalive) carries no data to deliver.
+func (c *Client) processLine(p *pending, line []byte) bool {
+	if len(line) == 0 {
+		return true
+	}
+
+	if bytes.HasPrefix(line, headerComment) {
+		// Comment line, e.g. a ": ping" keepalive. Ignored.
+		return false
+	}
+
+	switch {
+	case bytes.HasPrefix(line, headerID):
+		p.ID = append([]byte(nil), trimField(headerID, line)...)
+	case bytes.HasPrefix(line, headerData):
+		field := trimField(headerData, line)
+		if p.gotData {
+			p.Data = append(p.Data, '\n')
+		}
+		p.Data = append(p.Data, field...)
+		p.gotData = true
+	case bytes.HasPrefix(line, headerEvent):
+		p.Event.Event = append([]byte(nil), trimField(headerEvent, line)...)
+	case bytes.HasPrefix(line, headerError):
+		p.Error = append([]byte(nil), trimField(headerError, line)...)
 	}
 
+	return false
+}
+
+// finalize applies any remaining client-side processing to a completed
+// event before it is handed to the caller. A non-nil error indicates a
+// malformed frame; e is still returned so the caller can decide how to
+// handle it.
+func (c *Client) finalize(p pending) (*Event, error) {
+	e := p.Event
+
 	if len(e.Data) > 0 && c.EncodingBase64 {
 		buf := make([]byte, base64.StdEncoding.DecodedLen(len(e.Data)))
 
-		_, err := base64.StdEncoding.Decode(buf, e.Data)
+		n, err := base64.StdEncoding.Decode(buf, e.Data)
 		if err != nil {
-			log.Println(err)
+			return &e, err
 		}
 
-		e.Data = buf
+		e.Data = buf[:n]
 	}
 
-	return &e
+	return &e, nil
 }
 
-func (c *Client) cleanup(resp *http.Response, ch chan *Event) {
-	if resp != nil {
-		resp.Body.Close()
+// reportError sends err on errCh without blocking if it is full, or logs it
+// when the caller hasn't provided an errCh.
+func (c *Client) reportError(errCh chan error, err error) {
+	if errCh == nil {
+		log.Println(err)
+		return
+	}
+
+	select {
+	case errCh <- err:
+	default:
 	}
+}
 
+// trimField strips the field prefix and a single optional leading space.
+func trimField(prefix, line []byte) []byte {
+	data := line[len(prefix):]
+	if len(data) > 0 && data[0] == ' ' {
+		data = data[1:]
+	}
+	return data
+}
+
+// scanLines is a bufio.SplitFunc that splits on "\r\n", "\n" or a bare "\r",
+// as required by the SSE line-ending rules in the spec.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		if data[i] == '\n' {
+			return i + 1, data[:i], nil
+		}
+
+		// data[i] == '\r'
+		if i+1 < len(data) {
+			if data[i+1] == '\n' {
+				return i + 2, data[:i], nil
+			}
+			return i + 1, data[:i], nil
+		}
+
+		if atEOF {
+			return i + 1, data[:i], nil
+		}
+
+		// Need more data to know whether \r is followed by \n.
+		return 0, nil, nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+func (c *Client) teardown(ch chan *Event) {
 	c.Lock()
 	defer c.Unlock()
 
@@ -212,16 +425,3 @@ func (c *Client) cleanup(resp *http.Response, ch chan *Event) {
 		delete(c.subscribed, ch)
 	}
 }
-
-func trimHeader(size int, data []byte) []byte {
-	data = data[size:]
-	// Remove optional leading whitespace
-	if data[0] == 32 {
-		data = data[1:]
-	}
-	// Remove trailing new line
-	if data[len(data)-1] == 10 {
-		data = data[:len(data)-1]
-	}
-	return data
-}
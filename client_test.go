@@ -0,0 +1,109 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSubscribeReconnectsWithLastEventIDAndRetryDelay(t *testing.T) {
+	var attempt int32
+	var firstAttemptAt, secondAttemptAt time.Time
+	var secondLastEventID string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher := w.(http.Flusher)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		switch atomic.AddInt32(&attempt, 1) {
+		case 1:
+			firstAttemptAt = time.Now()
+			fmt.Fprint(w, "id: 1\nretry: 50\ndata: hello\n\n")
+			flusher.Flush()
+			// Return, ending the response so the client sees the stream
+			// close and has to reconnect.
+		default:
+			secondAttemptAt = time.Now()
+			secondLastEventID = r.Header.Get("Last-Event-ID")
+			fmt.Fprint(w, "id: 2\ndata: world\n\n")
+			flusher.Flush()
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events := make(chan *Event, 2)
+	go c.SubscribeWithContext(ctx, "", func(e *Event) {
+		events <- e
+	})
+
+	first := <-events
+	if string(first.Data) != "hello" {
+		t.Fatalf("first event Data = %q, want %q", first.Data, "hello")
+	}
+
+	second := <-events
+	if string(second.Data) != "world" {
+		t.Fatalf("second event Data = %q, want %q", second.Data, "world")
+	}
+
+	if secondLastEventID != "1" {
+		t.Fatalf("reconnect Last-Event-ID = %q, want %q", secondLastEventID, "1")
+	}
+
+	if d := secondAttemptAt.Sub(firstAttemptAt); d < 20*time.Millisecond {
+		t.Fatalf("reconnect happened after %v, want at least 20ms after the server's retry: 50", d)
+	}
+}
+
+func TestProcessLineOnlyDispatchesFramesWithData(t *testing.T) {
+	c := NewClient("")
+
+	var p pending
+	for _, line := range []string{": ping"} {
+		if c.processLine(&p, []byte(line)) {
+			t.Fatalf("processLine(%q) = true, want false (no blank line yet)", line)
+		}
+	}
+	if !c.processLine(&p, nil) {
+		t.Fatal("processLine on a blank line should signal the frame ended")
+	}
+	if p.gotData {
+		t.Fatal("comment-only frame should not have accumulated data")
+	}
+
+	p = pending{}
+	c.processLine(&p, []byte("id: 7"))
+	if !c.processLine(&p, nil) {
+		t.Fatal("processLine on a blank line should signal the frame ended")
+	}
+	if p.gotData {
+		t.Fatal("id-only frame should not have accumulated data")
+	}
+	c.trackEventID(&p.Event)
+	if c.EventID != "7" {
+		t.Fatalf("EventID = %q, want %q from an id-only frame", c.EventID, "7")
+	}
+
+	p = pending{}
+	c.processLine(&p, []byte("data: hi"))
+	if !c.processLine(&p, nil) {
+		t.Fatal("processLine on a blank line should signal the frame ended")
+	}
+	if !p.gotData {
+		t.Fatal("frame with a data field should have accumulated data")
+	}
+}
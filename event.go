@@ -0,0 +1,14 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+// Event represents a single message from an SSE stream, assembled from
+// the "field: value" lines between two blank lines.
+type Event struct {
+	ID    []byte
+	Data  []byte
+	Event []byte
+	Error []byte
+}
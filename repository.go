@@ -0,0 +1,78 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import "sync"
+
+// Repository supplies historical events for a stream so a Server can replay
+// them to a client that reconnects with a Last-Event-ID.
+type Repository interface {
+	// Replay returns a channel of the events published to streamID after
+	// lastEventID, closing the channel once replay is complete. An empty
+	// lastEventID means replay everything retained for the stream.
+	Replay(streamID, lastEventID string) chan *Event
+}
+
+// Recorder is implemented by Repositories that want Server.Publish to feed
+// them published events as they happen.
+type Recorder interface {
+	Append(streamID string, e *Event)
+}
+
+// ringRepository is an in-memory Repository that retains the last size
+// events published to each stream.
+type ringRepository struct {
+	size int
+
+	mu      sync.Mutex
+	streams map[string][]*Event
+}
+
+// NewRingRepository creates a Repository that keeps up to size of the most
+// recently published events per stream, discarding older ones.
+func NewRingRepository(size int) Repository {
+	return &ringRepository{
+		size:    size,
+		streams: make(map[string][]*Event),
+	}
+}
+
+// Append records e as having been published to streamID.
+func (r *ringRepository) Append(streamID string, e *Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := append(r.streams[streamID], e)
+	if len(buf) > r.size {
+		buf = buf[len(buf)-r.size:]
+	}
+	r.streams[streamID] = buf
+}
+
+// Replay returns the retained events for streamID that followed
+// lastEventID, or everything retained if lastEventID is empty or not found.
+func (r *ringRepository) Replay(streamID, lastEventID string) chan *Event {
+	r.mu.Lock()
+	buf := append([]*Event(nil), r.streams[streamID]...)
+	r.mu.Unlock()
+
+	start := 0
+	if lastEventID != "" {
+		for i, e := range buf {
+			if string(e.ID) == lastEventID {
+				start = i + 1
+				break
+			}
+		}
+	}
+
+	ch := make(chan *Event, len(buf)-start)
+	for _, e := range buf[start:] {
+		ch <- e
+	}
+	close(ch)
+
+	return ch
+}
@@ -0,0 +1,204 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	pingInterval   = 15 * time.Second
+	clientQueueLen = 16
+)
+
+// Server serves text/event-stream responses, demultiplexing clients by the
+// "stream" query parameter and broadcasting events published via Publish to
+// every client subscribed to the matching stream. When Repository is set,
+// a client reconnecting with Last-Event-ID is first replayed its missed
+// history before being switched over to the live broadcast.
+type Server struct {
+	Repository Repository
+
+	mu        sync.Mutex
+	streams   map[string]map[chan *Event]struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewServer creates a Server. repo may be nil, in which case reconnecting
+// clients simply resume from the live stream with no replay.
+func NewServer(repo Repository) *Server {
+	return &Server{
+		Repository: repo,
+		streams:    make(map[string]map[chan *Event]struct{}),
+		closed:     make(chan struct{}),
+	}
+}
+
+// Publish broadcasts e to every client currently subscribed to streamID,
+// and records it with Repository when one is configured. A client whose
+// queue is full has its oldest pending event dropped rather than blocking
+// the publisher.
+func (s *Server) Publish(streamID string, e *Event) {
+	if rec, ok := s.Repository.(Recorder); ok {
+		rec.Append(streamID, e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ch := range s.streams[streamID] {
+		select {
+		case ch <- e:
+		default:
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- e:
+			default:
+			}
+		}
+	}
+}
+
+// ServeHTTP subscribes the requesting client to the stream named by the
+// "stream" query parameter and streams events to it until the request is
+// cancelled or the Server is closed.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	streamID := r.URL.Query().Get("stream")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ch := make(chan *Event, clientQueueLen)
+	s.subscribe(streamID, ch)
+	defer s.unsubscribe(streamID, ch)
+
+	if s.Repository != nil {
+		if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+			for e := range s.Repository.Replay(streamID, lastID) {
+				if !writeEvent(w, flusher, e) {
+					return
+				}
+			}
+		}
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closed:
+			s.flush(w, flusher, ch)
+			return
+		case <-ping.C:
+			if !writeComment(w, flusher, "ping") {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !writeEvent(w, flusher, e) {
+				return
+			}
+		}
+	}
+}
+
+// Close signals every connected handler to stop, flushing any events still
+// queued for delivery before their connections close.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+func (s *Server) subscribe(streamID string, ch chan *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.streams[streamID] == nil {
+		s.streams[streamID] = make(map[chan *Event]struct{})
+	}
+	s.streams[streamID][ch] = struct{}{}
+}
+
+func (s *Server) unsubscribe(streamID string, ch chan *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.streams[streamID], ch)
+	if len(s.streams[streamID]) == 0 {
+		delete(s.streams, streamID)
+	}
+}
+
+// flush drains any events already queued for ch, writing them out before
+// the connection is torn down.
+func (s *Server) flush(w http.ResponseWriter, flusher http.Flusher, ch chan *Event) {
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !writeEvent(w, flusher, e) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, e *Event) bool {
+	if len(e.Event) > 0 {
+		if _, err := fmt.Fprintf(w, "event: %s\n", e.Event); err != nil {
+			return false
+		}
+	}
+	if len(e.ID) > 0 {
+		if _, err := fmt.Fprintf(w, "id: %s\n", e.ID); err != nil {
+			return false
+		}
+	}
+	if len(e.Data) > 0 {
+		for _, line := range bytes.Split(e.Data, []byte("\n")) {
+			if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+				return false
+			}
+		}
+	}
+	if _, err := fmt.Fprint(w, "\n"); err != nil {
+		return false
+	}
+	flusher.Flush()
+	return true
+}
+
+func writeComment(w http.ResponseWriter, flusher http.Flusher, comment string) bool {
+	if _, err := fmt.Fprintf(w, ": %s\n\n", comment); err != nil {
+		return false
+	}
+	flusher.Flush()
+	return true
+}
@@ -0,0 +1,56 @@
+/* This Source Code Form is subject to the terms of the Mozilla Public
+ * License, v. 2.0. If a copy of the MPL was not distributed with this
+ * file, You can obtain one at http://mozilla.org/MPL/2.0/. */
+
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+)
+
+// TypedEvent is the result of decoding an Event's Data as JSON into the Go
+// type registered for its event name.
+type TypedEvent struct {
+	Name  string
+	ID    string
+	Value interface{}
+}
+
+// SubscribeTyped subscribes to stream and forwards each event as a
+// TypedEvent on out, JSON-decoding its Data into a fresh value of the type
+// registry maps its Event name to. Events with an unregistered name are
+// dropped.
+func (c *Client) SubscribeTyped(stream string, registry map[string]reflect.Type, out chan<- TypedEvent) error {
+	return c.SubscribeTypedWithContext(context.Background(), stream, registry, nil, out, nil)
+}
+
+// SubscribeTypedWithContext is like SubscribeTyped, but the subscription is
+// cancelled with ctx, events whose name has no entry in registry are passed
+// to def instead of being dropped, and decode errors are reported on errCh
+// the same way as SubscribeChanWithContext.
+func (c *Client) SubscribeTypedWithContext(ctx context.Context, stream string, registry map[string]reflect.Type, def func(e *Event), out chan<- TypedEvent, errCh chan error) error {
+	return c.SubscribeWithContext(ctx, stream, func(e *Event) {
+		name := string(e.Event)
+
+		typ, ok := registry[name]
+		if !ok {
+			if def != nil {
+				def(e)
+			}
+			return
+		}
+
+		value := reflect.New(typ).Interface()
+		if err := json.Unmarshal(e.Data, value); err != nil {
+			c.reportError(errCh, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+		case out <- TypedEvent{Name: name, ID: string(e.ID), Value: value}:
+		}
+	})
+}